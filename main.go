@@ -1,248 +1,81 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"flag"
 	"fmt"
 	"os"
-	"net"
-	"sort"
+	"os/signal"
 	"strings"
-	"syscall"
 	"time"
-	"sync"
-)
-
-/* TODO
-	follow http redirects
-	starttls
-	add www, mx, mail....
-*/
-
-type DomainNode struct {
-	Domain string
-	Depth  int
-    Neighbors *[]string
-}
-
-// vars
-var conf = &tls.Config{
-	InsecureSkipVerify: true,
-}
-var markedDomains = make(map[string]bool)
-var domainGraph = make(map[string]*DomainNode)
-var timeout time.Duration
-var port string
-var verbose bool
-var depth int
-var maxDepth int
-var parallel int
-
-func v(a ...interface{}) {
-	if verbose {
-		fmt.Fprintln(os.Stderr, a...)
-	}
-}
-
-
-func checkNetErr(err error, domain string) bool {
-	if err == nil {
-		return false
-
-	} else if netError, ok := err.(net.Error); ok && netError.Timeout() {
-		v("Timeout", domain)
-	} else {
-		switch t := err.(type) {
-		case *net.OpError:
-			if t.Op == "dial" {
-				v("Unknown host", domain)
-			} else if t.Op == "read" {
-				v("Connection refused", domain)
-			}
-
-		case syscall.Errno:
-			if t == syscall.ECONNREFUSED {
-				v("Connection refused", domain)
-			}
-		}
-	}
-	return true
-}
-
-/*
-* given a domain returns the non-wildecard version of that domain
- */
-func directDomain(domain string) string {
-	if len(domain) < 3 {
-		return domain
-	}
-	if domain[0:2] == "*." {
-		domain = domain[2:]
-	}
-	return domain
-}
-
-func printGraph() {
-	// print map in sorted order
-	domains := make([]string, 0, len(domainGraph))
-	for domain, _ := range domainGraph {
-		domains = append(domains, domain)
-	}
-	sort.Strings(domains)
-
-	for _, domain := range domains {
-		fmt.Println(domain, domainGraph[domain].Depth, *domainGraph[domain].Neighbors)
-	}
-}
 
+	"github.com/elamaran619/certgraph/pkg/crawler"
+)
 
 func main() {
 	host := flag.String("host", "localhost", "Host to Scan")
-	flag.StringVar(&port, "port", "443", "Port to connect to")
+	port := flag.String("port", "443", "Port to connect to")
 	timeoutPtr := flag.Int("timeout", 5, "TCP Timeout in seconds")
-	flag.BoolVar(&verbose, "verbose", false, "Verbose logging")
-	flag.IntVar(&maxDepth, "depth", 20, "Maximum BFS depth to go")
-	flag.IntVar(&parallel, "parallel", 10, "Number of certificates to retrieve in parallel")
+	verbose := flag.Bool("verbose", false, "Verbose logging")
+	maxDepth := flag.Int("depth", 20, "Maximum BFS depth to go")
+	parallel := flag.Int("parallel", 10, "Number of certificates to retrieve in parallel")
+	source := flag.String("source", "tls", "Discovery source: tls, ct, or both")
+	ctEndpoint := flag.String("ct-endpoint", "", "crt.sh-compatible CT search endpoint to query for --source=ct/both, default https://crt.sh")
+	resolveDNS := flag.Bool("resolve", false, "Also expand neighbors via DNS (MX/NS/CNAME and common prefixes)")
+	nameserver := flag.String("nameserver", "", "Nameserver (host:port) to use for DNS resolution, default system resolver")
+	format := flag.String("format", "text", "Output format: text, json, dot, or gexf")
+	starttls := flag.String("starttls", "", "Perform a STARTTLS handshake before the TLS handshake: smtp, imap, pop3, xmpp, ftp, or auto")
+	qps := flag.Float64("qps", 0, "Global dial rate limit across all hosts, in requests/sec (0 = unlimited)")
+	perHostQPS := flag.Float64("per-host-qps", 0, "Per-host dial rate limit, in requests/sec (0 = unlimited)")
 
 	flag.Parse()
-	if parallel < 1 {
+	if *parallel < 1 {
 		fmt.Fprintln(os.Stderr, "Must enter a positive number of parallel threads")
 		return
 	}
-	timeout = time.Duration(*timeoutPtr) * time.Second
-	startDomain := strings.ToLower(*host)
-
-	BFS(startDomain)
-
-	v("Done...")
-
-	printGraph()
-
-	v("Found", len(domainGraph), "domains") // todo verify
-	v("Graph Depth:", depth)
-
-}
-
-func BFS(root string) {
-	// parallel code
-	var wg sync.WaitGroup
-	domainChan := make(chan *DomainNode, 5)
-	domainGraphChan := make(chan *DomainNode, 5)
-
-	// thread limit code
-	threadPass := make(chan bool, parallel)
-	for i:=0; i< parallel; i++ {
-		threadPass <-true
-	}
-
-	wg.Add(1)
-	domainChan <- &DomainNode{root, 0, nil}
-	go func() {
-		for {
-			domainNode := <- domainChan
-
-			// depth check
-			if domainNode.Depth > maxDepth {
-				v("Max depth reached, skipping:", domainNode.Domain)
-				wg.Done()
-				continue
-			}
-			if domainNode.Depth > depth {
-				depth = domainNode.Depth
-			}
-
-			dDomain := directDomain(domainNode.Domain)
-			if !markedDomains[dDomain] {
-				markedDomains[dDomain] = true
-				go func(domainNode *DomainNode) {
-				 	defer wg.Done()
-				 	// wait for pass
-				 	<-threadPass
-				 	defer func() {threadPass <- true}()
-
-					// do things
-					dDomain := directDomain(domainNode.Domain)
-					v("Visiting", domainNode.Depth, dDomain)
-					neighbors := BFSPeers(dDomain) // visit
-					domainNode.Neighbors = &neighbors
-					domainGraphChan <- domainNode
-					for _, neighbor := range neighbors {
-						wg.Add(1)
-						domainChan <- &DomainNode{neighbor, domainNode.Depth + 1, nil}
-					}
-				}(domainNode)
-			} else {
-				wg.Done()
-			}
-		}
-	}()
-
-	// save thread
-	done := make(chan bool)
-	go func() {
-		for {
-			domainNode, more := <- domainGraphChan
-			if more {
-				dDomain := directDomain(domainNode.Domain)
-				domainGraph[dDomain] = domainNode // not thread safe
-			} else {
-				done <- true
-				return
-			}
-		}
-	}()
-
-	wg.Wait() // wait for querying to finish
-	close(domainGraphChan)
-	<-done // wait for save to finish
-}
-
-func BFSPeers(host string) []string {
-	domains := make([]string, 0)
-	certs := getPeerCerts(host)
-
-	if len(certs) == 0 {
-		return domains
+	if *starttls != "" && *starttls != "auto" && !crawler.StartTLSProtocols[*starttls] {
+		fmt.Fprintln(os.Stderr, "Unsupported --starttls protocol:", *starttls)
+		return
 	}
-
-	// used to ensure uniq entries in domains array
-	domainMap := make(map[string]bool)
-
-	// add the CommonName just to be safe
-	if len(certs) > 0 {
-		cn := strings.ToLower(certs[0].Subject.CommonName)
-		if len(cn) > 0 {
-			domainMap[cn] = true
+	// If the user named a STARTTLS protocol but left --port at its default,
+	// dial that protocol's conventional plaintext port instead of 443.
+	portExplicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			portExplicit = true
 		}
-	}
-
-	for _, cert := range certs {
-		for _, domain := range cert.DNSNames {
-			if len(domain) > 0 {
-				domain = strings.ToLower(domain)
-				domainMap[domain] = true
-			}
+	})
+	if *starttls != "" && *starttls != "auto" && !portExplicit {
+		if def, ok := crawler.DefaultPort[*starttls]; ok {
+			*port = def
 		}
 	}
+	startDomain := strings.ToLower(*host)
 
-	for domain, _ := range domainMap {
-		domains = append(domains, domain)
+	c := crawler.New(crawler.Options{
+		Port:       *port,
+		Timeout:    time.Duration(*timeoutPtr) * time.Second,
+		MaxDepth:   *maxDepth,
+		Parallel:   *parallel,
+		Verbose:    *verbose,
+		Source:     *source,
+		CTEndpoint: *ctEndpoint,
+		ResolveDNS: *resolveDNS,
+		Nameserver: *nameserver,
+		StartTLS:   *starttls,
+		QPS:        *qps,
+		PerHostQPS: *perHostQPS,
+	})
+
+	// Cancel the crawl on SIGINT/SIGTERM so a ^C during a long scan shuts
+	// down cleanly instead of leaving dangling goroutines.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	graph, err := c.Crawl(ctx, []string{startDomain})
+	if err != nil && err != context.Canceled {
+		fmt.Fprintln(os.Stderr, "Crawl error:", err)
 	}
-	sort.Strings(domains)
-	return domains
 
-}
-
-func getPeerCerts(host string) []*x509.Certificate {
-	addr := net.JoinHostPort(host, port)
-	dialer := &net.Dialer{Timeout: timeout}
-	conn, err := tls.DialWithDialer(dialer, "tcp", addr, conf)
-	if checkNetErr(err, host) {
-		return make([]*x509.Certificate, 0)
-
-	}
-	conn.Close()
-	connState := conn.ConnectionState()
-	return connState.PeerCertificates
+	crawler.WriteGraph(graph, os.Stdout, *format)
 }
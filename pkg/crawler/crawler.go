@@ -0,0 +1,406 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+/* TODO
+follow http redirects
+*/
+
+// Options configures a Crawler.
+type Options struct {
+	Port       string
+	Timeout    time.Duration
+	MaxDepth   int
+	Parallel   int
+	Verbose    bool
+	Source     string // tls, ct, or both
+	CTEndpoint string // crt.sh-compatible CT search endpoint, default https://crt.sh
+	ResolveDNS bool
+	Nameserver string
+	StartTLS   string // "", smtp, imap, pop3, xmpp, ftp, or auto
+	QPS        float64
+	PerHostQPS float64
+}
+
+// Crawler walks a certificate graph breadth-first starting from a set of
+// seed domains. It holds no package-level state, so multiple Crawlers (with
+// independent Options) can run concurrently in the same process.
+type Crawler struct {
+	opts Options
+	conf *tls.Config
+
+	mu            sync.Mutex
+	markedDomains map[string]bool
+	graph         *Graph
+	depth         int
+
+	// ctHosts rate-limits CTSource's HTTP calls per CT endpoint, set once
+	// in Crawl before any worker starts and only read afterward.
+	ctHosts *hostLimiters
+
+	// sourcesOverride lets tests substitute synthetic CertSources that never
+	// touch the network; production code never sets it.
+	sourcesOverride []CertSource
+
+	// Backpressure counters read by Metrics, updated with atomic ops since
+	// workers touch them from outside c.mu's critical sections.
+	queued, inFlight, visited int64
+}
+
+// New builds a Crawler from the given Options.
+func New(opts Options) *Crawler {
+	if opts.Port == "" {
+		opts.Port = "443"
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	if opts.Source == "" {
+		opts.Source = "tls"
+	}
+	if opts.CTEndpoint == "" {
+		opts.CTEndpoint = "https://crt.sh"
+	}
+	return &Crawler{
+		opts:          opts,
+		conf:          &tls.Config{InsecureSkipVerify: true},
+		markedDomains: make(map[string]bool),
+	}
+}
+
+func (c *Crawler) v(a ...interface{}) {
+	if c.opts.Verbose {
+		fmt.Fprintln(os.Stderr, a...)
+	}
+}
+
+func checkNetErr(err error, domain string, log func(a ...interface{})) bool {
+	if err == nil {
+		return false
+
+	} else if netError, ok := err.(net.Error); ok && netError.Timeout() {
+		log("Timeout", domain)
+	} else {
+		switch t := err.(type) {
+		case *net.OpError:
+			if t.Op == "dial" {
+				log("Unknown host", domain)
+			} else if t.Op == "read" {
+				log("Connection refused", domain)
+			}
+
+		case syscall.Errno:
+			if t == syscall.ECONNREFUSED {
+				log("Connection refused", domain)
+			}
+		}
+	}
+	return true
+}
+
+/*
+* given a domain returns the non-wildecard version of that domain
+ */
+func directDomain(domain string) string {
+	if len(domain) < 3 {
+		return domain
+	}
+	if domain[0:2] == "*." {
+		domain = domain[2:]
+	}
+	return domain
+}
+
+// Crawl runs a breadth-first search over the certificate (and, if
+// --resolve is set, DNS) graph starting from seeds, and returns once every
+// reachable domain (bounded by MaxDepth) has been visited or ctx is
+// cancelled. Work is dispatched to a fixed pool of Parallel worker
+// goroutines draining an unbounded domainQueue, so a deep BFS fans out
+// without spawning a goroutine per domain; --qps and --per-host-qps token
+// buckets throttle how fast workers dial out. A cancelled ctx stops new
+// dials from starting but lets in-flight ones unwind on their own, so
+// Crawl returns ctx.Err() rather than leaving goroutines behind.
+func (c *Crawler) Crawl(ctx context.Context, seeds []string) (*Graph, error) {
+	c.graph = &Graph{Nodes: make(map[string]*DomainNode)}
+
+	// queueCtx governs the worker pool's own goroutines (the queue relay,
+	// the rate limiter tickers, the workers themselves) and is distinct
+	// from ctx, which the caller may cancel mid-crawl. Tying the pool's
+	// lifetime to ctx directly would let it tear down while domains are
+	// still buffered in queue, dropping them without a matching wg.Done
+	// and deadlocking Wait below; instead visit honors ctx to cut dials
+	// short, and the pool itself only stops once every dispatched domain
+	// has actually been drained.
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	defer stopQueue()
+
+	queue := newDomainQueue(queueCtx)
+	global := newRateLimiter(c.opts.QPS)
+	hosts := newHostLimiters(c.opts.PerHostQPS)
+	dnsHosts := newHostLimiters(c.opts.PerHostQPS)
+	c.ctHosts = newHostLimiters(c.opts.PerHostQPS)
+
+	var wg sync.WaitGroup
+	enqueue := func(n *DomainNode) {
+		wg.Add(1)
+		atomic.AddInt64(&c.queued, 1)
+		queue.push(n)
+	}
+
+	for _, seed := range seeds {
+		enqueue(&DomainNode{Domain: seed})
+	}
+
+	for i := 0; i < c.opts.Parallel; i++ {
+		go c.worker(queueCtx, ctx, queue, global, hosts, dnsHosts, &wg, enqueue)
+	}
+
+	if c.opts.Verbose {
+		go c.logMetrics(queueCtx)
+	}
+
+	wg.Wait() // wait for every dispatched domain to be visited
+
+	c.v("Found", len(c.graph.Nodes), "domains")
+	c.v("Graph Depth:", c.depth)
+
+	return c.graph, ctx.Err()
+}
+
+// worker drains queue until queueCtx is cancelled, visiting each domain it
+// receives. It's one of a fixed pool of Parallel such goroutines, which
+// bounds how many visits run concurrently regardless of how deep or wide
+// the BFS fans out.
+func (c *Crawler) worker(queueCtx, ctx context.Context, queue *domainQueue, global *rateLimiter, hosts, dnsHosts *hostLimiters, wg *sync.WaitGroup, enqueue func(*DomainNode)) {
+	for {
+		select {
+		case <-queueCtx.Done():
+			return
+		case domainNode := <-queue.out:
+			c.visit(ctx, domainNode, global, hosts, dnsHosts, enqueue)
+			wg.Done()
+		}
+	}
+}
+
+// visit resolves a single domain's neighbors, subject to the depth limit,
+// dedup against markedDomains, and the global/per-host rate limiters, then
+// enqueues any newly discovered neighbors for a future visit.
+func (c *Crawler) visit(ctx context.Context, domainNode *DomainNode, global *rateLimiter, hosts, dnsHosts *hostLimiters, enqueue func(*DomainNode)) {
+	atomic.AddInt64(&c.queued, -1)
+
+	if domainNode.Depth > c.opts.MaxDepth {
+		c.v("Max depth reached, skipping:", domainNode.Domain)
+		return
+	}
+
+	dDomain := directDomain(domainNode.Domain)
+
+	c.mu.Lock()
+	if domainNode.Depth > c.depth {
+		c.depth = domainNode.Depth
+	}
+	alreadyVisited := c.markedDomains[dDomain]
+	if !alreadyVisited {
+		c.markedDomains[dDomain] = true
+	}
+	c.mu.Unlock()
+	if alreadyVisited {
+		return
+	}
+
+	if err := global.wait(ctx); err != nil {
+		return
+	}
+	if err := hosts.get(dDomain).wait(ctx); err != nil {
+		return
+	}
+
+	atomic.AddInt64(&c.inFlight, 1)
+	c.v("Visiting", domainNode.Depth, dDomain)
+	neighbors, certInfo := c.bfsPeers(ctx, dDomain)
+	if c.opts.ResolveDNS {
+		neighbors = append(neighbors, c.bfsNeighborsDNS(ctx, dDomain, dnsHosts)...)
+	}
+	atomic.AddInt64(&c.inFlight, -1)
+	atomic.AddInt64(&c.visited, 1)
+
+	domainNode.Neighbors = &neighbors
+	domainNode.Cert = certInfo
+	c.mu.Lock()
+	c.graph.Nodes[dDomain] = domainNode
+	c.mu.Unlock()
+
+	for _, neighbor := range neighbors {
+		enqueue(&DomainNode{Domain: neighbor.Domain, Depth: domainNode.Depth + 1})
+	}
+}
+
+// Metrics returns a point-in-time snapshot of the crawl's backpressure,
+// handy for deciding whether --parallel, --qps or --per-host-qps need
+// tuning.
+func (c *Crawler) Metrics() Metrics {
+	return Metrics{
+		Queued:   atomic.LoadInt64(&c.queued),
+		InFlight: atomic.LoadInt64(&c.inFlight),
+		Visited:  atomic.LoadInt64(&c.visited),
+	}
+}
+
+// logMetrics writes Metrics to verbose output on a fixed interval until ctx
+// is done.
+func (c *Crawler) logMetrics(ctx context.Context) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m := c.Metrics()
+			c.v("queued:", m.Queued, "in-flight:", m.InFlight, "visited:", m.Visited)
+		}
+	}
+}
+
+func (c *Crawler) bfsPeers(ctx context.Context, host string) ([]Neighbor, *CertInfo) {
+	domains := make([]Neighbor, 0)
+	var certs []*x509.Certificate
+	for _, src := range c.sourcesFor(c.opts.Source) {
+		srcCerts, err := src.GetCerts(ctx, host)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, srcCerts...)
+	}
+	certs = dedupeCerts(certs)
+
+	if len(certs) == 0 {
+		return domains, nil
+	}
+
+	// used to ensure uniq entries in domains array
+	domainMap := make(map[string]bool)
+
+	// add the CommonName just to be safe
+	if len(certs) > 0 {
+		cn := strings.ToLower(certs[0].Subject.CommonName)
+		if len(cn) > 0 {
+			domainMap[cn] = true
+		}
+	}
+
+	for _, cert := range certs {
+		for _, domain := range cert.DNSNames {
+			if len(domain) > 0 {
+				domain = strings.ToLower(domain)
+				domainMap[domain] = true
+			}
+		}
+	}
+
+	uniqDomains := make([]string, 0, len(domainMap))
+	for domain := range domainMap {
+		uniqDomains = append(uniqDomains, domain)
+	}
+	sort.Strings(uniqDomains)
+	for _, domain := range uniqDomains {
+		domains = append(domains, Neighbor{Domain: domain, Source: "cert"})
+	}
+
+	leaf := certs[0]
+	certInfo := &CertInfo{
+		Fingerprint: certFingerprint(leaf),
+		Issuer:      leaf.Issuer.CommonName,
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+	}
+
+	return domains, certInfo
+}
+
+// certFingerprint is the SHA-256 of a certificate's DER encoding, used both
+// to report CertInfo.Fingerprint and to dedupe certs seen from more than
+// one CertSource. Certs synthesized without their original DER (e.g. a CT
+// source that couldn't recover the raw bytes) fall back to hashing their
+// CN and SANs instead, so they don't all collide on the hash of an empty
+// byte slice.
+func certFingerprint(cert *x509.Certificate) string {
+	if len(cert.Raw) > 0 {
+		return fmt.Sprintf("%x", sha256.Sum256(cert.Raw))
+	}
+	key := cert.Subject.CommonName + "|" + strings.Join(cert.DNSNames, ",")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
+
+// dedupeCerts drops certs already seen (by certFingerprint) from an earlier
+// CertSource, so querying --source=both doesn't double-count a cert that
+// both a live TLS dial and a CT log happen to turn up.
+func dedupeCerts(certs []*x509.Certificate) []*x509.Certificate {
+	seen := make(map[string]bool, len(certs))
+	out := make([]*x509.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		fp := certFingerprint(cert)
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+		out = append(out, cert)
+	}
+	return out
+}
+
+func (c *Crawler) getPeerCerts(ctx context.Context, host string) []*x509.Certificate {
+	protocol := starttlsProtocol(c.opts.StartTLS, c.opts.Port)
+	if protocol != "" {
+		return c.getPeerCertsStartTLS(ctx, host, protocol)
+	}
+
+	addr := net.JoinHostPort(host, c.opts.Port)
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: c.opts.Timeout}, Config: c.conf}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if checkNetErr(err, host, c.v) {
+		return make([]*x509.Certificate, 0)
+	}
+	defer conn.Close()
+	connState := conn.(*tls.Conn).ConnectionState()
+	return connState.PeerCertificates
+}
+
+// getPeerCertsStartTLS dials host in the clear, performs the protocol's
+// STARTTLS handshake, then hands the now-upgradeable connection to
+// tls.Client using the same conf as a direct TLS dial.
+func (c *Crawler) getPeerCertsStartTLS(ctx context.Context, host, protocol string) []*x509.Certificate {
+	addr := net.JoinHostPort(host, c.opts.Port)
+	netDialer := &net.Dialer{Timeout: c.opts.Timeout}
+	conn, err := netDialer.DialContext(ctx, "tcp", addr)
+	if checkNetErr(err, host, c.v) {
+		return make([]*x509.Certificate, 0)
+	}
+	defer conn.Close()
+
+	if err := starttlsUpgrade(conn, protocol, host); err != nil {
+		c.v("STARTTLS failed", host, err)
+		return make([]*x509.Certificate, 0)
+	}
+
+	tlsConn := tls.Client(conn, c.conf)
+	if err := tlsConn.HandshakeContext(ctx); checkNetErr(err, host, c.v) {
+		return make([]*x509.Certificate, 0)
+	}
+	return tlsConn.ConnectionState().PeerCertificates
+}
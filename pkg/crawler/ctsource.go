@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CertSource is implemented by anything that can discover certificates for a
+// domain. TLSSource dials the host directly; CTSource queries a certificate
+// transparency log instead, which works even when the host isn't reachable
+// on the scan port.
+type CertSource interface {
+	GetCerts(ctx context.Context, domain string) ([]*x509.Certificate, error)
+}
+
+// TLSSource retrieves the live certificate chain by dialing the host.
+type TLSSource struct {
+	crawler *Crawler
+}
+
+func (s TLSSource) GetCerts(ctx context.Context, domain string) ([]*x509.Certificate, error) {
+	return s.crawler.getPeerCerts(ctx, domain), nil
+}
+
+// CTSource discovers certificates by querying a crt.sh-compatible
+// certificate transparency search endpoint instead of dialing the host.
+type CTSource struct {
+	crawler *Crawler
+}
+
+// crtShEntry mirrors the fields we care about from crt.sh's JSON output. ID
+// is crt.sh's own certificate ID, used both to dedupe entries across pages
+// and to fetch the certificate's actual DER/PEM body afterward.
+type crtShEntry struct {
+	ID         int64  `json:"id"`
+	CommonName string `json:"common_name"`
+	NameValue  string `json:"name_value"`
+}
+
+// ctPageSize is the result count above which we assume crt.sh has more
+// pages to give us; ctMaxPages bounds how many we'll ask for, so a
+// non-paginating endpoint (crt.sh's own JSON search ignores unknown query
+// params and always returns everything on page one) can't spin us forever.
+const (
+	ctPageSize = 1000
+	ctMaxPages = 10
+)
+
+// httpClient returns an http.Client bounded by --timeout, so a CT endpoint
+// that accepts a connection and never responds can't hang a worker
+// indefinitely; ctx's own cancellation (e.g. SIGINT) still applies on top.
+func (s CTSource) httpClient() *http.Client {
+	return &http.Client{Timeout: s.crawler.opts.Timeout}
+}
+
+func (s CTSource) GetCerts(ctx context.Context, domain string) ([]*x509.Certificate, error) {
+	entries, err := s.fetchEntries(ctx, domain)
+	if err != nil {
+		s.crawler.v("CT lookup failed", domain, err)
+		return nil, err
+	}
+
+	certs := make([]*x509.Certificate, 0, len(entries))
+	for _, entry := range entries {
+		cert, err := s.fetchCert(ctx, entry)
+		if err != nil {
+			s.crawler.v("CT cert fetch failed, falling back to SAN-only record", domain, entry.ID, err)
+			names := strings.Split(entry.NameValue, "\n")
+			cert = &x509.Certificate{Subject: pkix.Name{CommonName: entry.CommonName}, DNSNames: names}
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// fetchEntries pages through the CT search endpoint, deduping by crt.sh ID,
+// until a page comes back short of ctPageSize or introduces nothing new.
+func (s CTSource) fetchEntries(ctx context.Context, domain string) ([]crtShEntry, error) {
+	seen := make(map[int64]bool)
+	var entries []crtShEntry
+
+	for page := 1; page <= ctMaxPages; page++ {
+		pageEntries, err := s.fetchPage(ctx, domain, page)
+		if err != nil {
+			if page == 1 {
+				return nil, err
+			}
+			s.crawler.v("CT pagination stopped early", domain, "page", page, err)
+			break
+		}
+
+		newCount := 0
+		for _, entry := range pageEntries {
+			if seen[entry.ID] {
+				continue
+			}
+			seen[entry.ID] = true
+			entries = append(entries, entry)
+			newCount++
+		}
+
+		if len(pageEntries) < ctPageSize || newCount == 0 {
+			break
+		}
+		if page == ctMaxPages {
+			s.crawler.v("CT pagination cap reached, results may be incomplete", domain, "pages", ctMaxPages)
+		}
+	}
+	return entries, nil
+}
+
+func (s CTSource) fetchPage(ctx context.Context, domain string, page int) ([]crtShEntry, error) {
+	if err := s.crawler.ctHosts.get(s.crawler.opts.CTEndpoint).wait(ctx); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/?q=%s&output=json&p=%d", s.crawler.opts.CTEndpoint, domain, page)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var entries []crtShEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// fetchCert retrieves a CT-logged certificate's actual PEM body from the CT
+// endpoint (crt.sh serves this at /?d=<id>) and parses it, giving us real
+// DER bytes to compute CertInfo.Fingerprint from instead of a synthesized,
+// indistinguishable-from-every-other-cert placeholder.
+func (s CTSource) fetchCert(ctx context.Context, entry crtShEntry) (*x509.Certificate, error) {
+	if err := s.crawler.ctHosts.get(s.crawler.opts.CTEndpoint).wait(ctx); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/?d=%d", s.crawler.opts.CTEndpoint, entry.ID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in CT response for cert id %d", entry.ID)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// sourcesFor returns the CertSource(s) selected by the --source flag, or
+// c.sourcesOverride if a test has set one.
+func (c *Crawler) sourcesFor(name string) []CertSource {
+	if c.sourcesOverride != nil {
+		return c.sourcesOverride
+	}
+	switch name {
+	case "ct":
+		return []CertSource{CTSource{crawler: c}}
+	case "both":
+		return []CertSource{TLSSource{crawler: c}, CTSource{crawler: c}}
+	default:
+		return []CertSource{TLSSource{crawler: c}}
+	}
+}
@@ -0,0 +1,28 @@
+package crawler
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestCertFingerprintDistinguishesRawlessCerts(t *testing.T) {
+	a := &x509.Certificate{Subject: pkix.Name{CommonName: "a.example.com"}, DNSNames: []string{"a.example.com"}}
+	b := &x509.Certificate{Subject: pkix.Name{CommonName: "b.example.com"}, DNSNames: []string{"b.example.com"}}
+
+	fpA, fpB := certFingerprint(a), certFingerprint(b)
+	if fpA == fpB {
+		t.Fatalf("expected distinct fingerprints for distinct raw-less certs, got %q for both", fpA)
+	}
+}
+
+func TestDedupeCertsDropsRepeatsAcrossSources(t *testing.T) {
+	same := &x509.Certificate{Raw: []byte("same-cert-bytes")}
+	sameAgain := &x509.Certificate{Raw: []byte("same-cert-bytes")}
+	other := &x509.Certificate{Raw: []byte("other-cert-bytes")}
+
+	got := dedupeCerts([]*x509.Certificate{same, sameAgain, other})
+	if len(got) != 2 {
+		t.Fatalf("got %d certs, want 2 (one dedupe'd pair, one distinct)", len(got))
+	}
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// commonPrefixes is probed against every discovered domain's base zone when
+// DNS resolution is enabled, since a lot of infrastructure hangs off of
+// predictable hostnames that never show up in a cert's SAN list.
+var commonPrefixes = []string{
+	"www", "mail", "mx", "smtp", "imap", "webmail", "vpn", "api", "dev", "staging",
+}
+
+// Resolver looks up the DNS neighbors of a domain: its MX, NS and CNAME
+// targets, plus any common hostname prefixes that resolve under the same
+// zone.
+type Resolver interface {
+	// key identifies the nameserver being queried (e.g. its host:port, or
+	// "system" for the process-wide default), so callers can rate-limit
+	// per nameserver rather than per domain.
+	key() string
+	Resolve(ctx context.Context, domain string, limiter *rateLimiter) []string
+}
+
+// DefaultResolver uses the process-wide Go resolver.
+type DefaultResolver struct{}
+
+func (DefaultResolver) key() string { return "system" }
+
+func (DefaultResolver) Resolve(ctx context.Context, domain string, limiter *rateLimiter) []string {
+	return resolveWith(ctx, net.DefaultResolver, domain, limiter)
+}
+
+// NameserverResolver queries a specific nameserver instead of the system
+// default, using the stdlib resolver's pure-Go dialer override so we don't
+// need a third-party DNS library.
+type NameserverResolver struct {
+	Nameserver string // host:port, e.g. "8.8.8.8:53"
+	Timeout    time.Duration
+}
+
+func (r NameserverResolver) key() string { return r.Nameserver }
+
+func (r NameserverResolver) Resolve(ctx context.Context, domain string, limiter *rateLimiter) []string {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: r.Timeout}
+			return d.DialContext(ctx, network, r.Nameserver)
+		},
+	}
+	return resolveWith(ctx, resolver, domain, limiter)
+}
+
+// resolveWith issues each of its DNS queries (MX, NS, CNAME, and one
+// LookupHost per commonPrefixes entry) against limiter in turn, so a
+// single domain's resolution doesn't burst a dozen-plus queries at the
+// nameserver at once; limiter is keyed by nameserver, so --per-host-qps
+// still throttles concurrent workers sharing the same resolver.
+func resolveWith(ctx context.Context, resolver *net.Resolver, domain string, limiter *rateLimiter) []string {
+	found := make(map[string]bool)
+
+	if limiter.wait(ctx) == nil {
+		if mxs, err := resolver.LookupMX(ctx, domain); err == nil {
+			for _, mx := range mxs {
+				found[strings.ToLower(strings.TrimSuffix(mx.Host, "."))] = true
+			}
+		}
+	}
+
+	if limiter.wait(ctx) == nil {
+		if nss, err := resolver.LookupNS(ctx, domain); err == nil {
+			for _, ns := range nss {
+				found[strings.ToLower(strings.TrimSuffix(ns.Host, "."))] = true
+			}
+		}
+	}
+
+	if limiter.wait(ctx) == nil {
+		if cname, err := resolver.LookupCNAME(ctx, domain); err == nil {
+			cname = strings.ToLower(strings.TrimSuffix(cname, "."))
+			if cname != "" && cname != domain+"." {
+				found[cname] = true
+			}
+		}
+	}
+
+	for _, prefix := range commonPrefixes {
+		if limiter.wait(ctx) != nil {
+			break // ctx cancelled while waiting for a token
+		}
+		candidate := prefix + "." + domain
+		if _, err := resolver.LookupHost(ctx, candidate); err == nil {
+			found[candidate] = true
+		}
+	}
+
+	delete(found, domain)
+	neighbors := make([]string, 0, len(found))
+	for hostname := range found {
+		neighbors = append(neighbors, hostname)
+	}
+	return neighbors
+}
+
+// resolverFor returns the Resolver selected by the --nameserver flag
+// ("" meaning use the system default).
+func (c *Crawler) resolverFor(nameserver string) Resolver {
+	if nameserver == "" {
+		return DefaultResolver{}
+	}
+	return NameserverResolver{Nameserver: nameserver, Timeout: c.opts.Timeout}
+}
+
+// bfsNeighborsDNS resolves the DNS-derived neighbors of a domain (MX/NS/CNAME
+// targets and common hostname prefixes), tagged distinctly from cert-derived
+// neighbors so the graph can tell the two apart. dnsHosts rate-limits the
+// individual DNS queries per nameserver, independent of the per-domain
+// limiter that gates bfsPeers.
+func (c *Crawler) bfsNeighborsDNS(ctx context.Context, host string, dnsHosts *hostLimiters) []Neighbor {
+	resolver := c.resolverFor(c.opts.Nameserver)
+	hostnames := resolver.Resolve(ctx, host, dnsHosts.get(resolver.key()))
+	neighbors := make([]Neighbor, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		neighbors = append(neighbors, Neighbor{Domain: hostname, Source: "dns"})
+	}
+	return neighbors
+}
@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"sort"
+	"time"
+)
+
+// Graph is the result of a Crawl: every domain visited, keyed by its
+// direct (non-wildcard) form.
+type Graph struct {
+	Nodes map[string]*DomainNode
+}
+
+// sortedDomains returns the graph's keys in sorted order, shared by every
+// output format so they all render nodes in a stable order.
+func (g *Graph) sortedDomains() []string {
+	domains := make([]string, 0, len(g.Nodes))
+	for domain := range g.Nodes {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+type DomainNode struct {
+	Domain    string
+	Depth     int
+	Neighbors *[]Neighbor
+	Cert      *CertInfo
+}
+
+// CertInfo is the subset of a leaf certificate's metadata worth carrying
+// around in the graph for downstream analysis.
+type CertInfo struct {
+	Fingerprint string
+	Issuer      string
+	NotBefore   time.Time
+	NotAfter    time.Time
+}
+
+// Neighbor is an edge discovered from a DomainNode, tagged with where it
+// came from so the graph can distinguish cert-derived from DNS-derived
+// edges.
+type Neighbor struct {
+	Domain string `json:"domain"`
+	Source string `json:"source"` // "cert" or "dns"
+}
@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// WriteGraph renders a Graph in the selected format. Anything other than
+// the recognized formats falls back to "text" so a typo'd --format doesn't
+// silently produce an empty scan result.
+func WriteGraph(g *Graph, w io.Writer, format string) {
+	switch format {
+	case "json":
+		writeGraphJSON(g, w)
+	case "dot":
+		writeGraphDOT(g, w)
+	case "gexf":
+		writeGraphGEXF(g, w)
+	default:
+		writeGraphText(g, w)
+	}
+}
+
+func writeGraphText(g *Graph, w io.Writer) {
+	for _, domain := range g.sortedDomains() {
+		node := g.Nodes[domain]
+		neighbors := make([]string, 0)
+		for _, neighbor := range *node.Neighbors {
+			neighbors = append(neighbors, neighbor.Domain+"("+neighbor.Source+")")
+		}
+		fmt.Fprintln(w, domain, node.Depth, neighbors)
+	}
+}
+
+// jsonNode is the NDJSON record emitted per domain, one line per node so a
+// scan can be streamed into jq or bulk-loaded without holding the whole
+// graph in memory.
+type jsonNode struct {
+	Domain      string     `json:"domain"`
+	Depth       int        `json:"depth"`
+	Neighbors   []Neighbor `json:"neighbors"`
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	NotBefore   string     `json:"notBefore,omitempty"`
+	NotAfter    string     `json:"notAfter,omitempty"`
+}
+
+func writeGraphJSON(g *Graph, w io.Writer) {
+	enc := json.NewEncoder(w)
+	for _, domain := range g.sortedDomains() {
+		node := g.Nodes[domain]
+		record := jsonNode{
+			Domain:    domain,
+			Depth:     node.Depth,
+			Neighbors: *node.Neighbors,
+		}
+		if node.Cert != nil {
+			record.Fingerprint = node.Cert.Fingerprint
+			record.Issuer = node.Cert.Issuer
+			record.NotBefore = node.Cert.NotBefore.Format("2006-01-02T15:04:05Z07:00")
+			record.NotAfter = node.Cert.NotAfter.Format("2006-01-02T15:04:05Z07:00")
+		}
+		enc.Encode(record)
+	}
+}
+
+// depthColors cycles through a small palette so deeper BFS layers are
+// visually distinguishable when the DOT output is rendered by Graphviz.
+var depthColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b"}
+
+func writeGraphDOT(g *Graph, w io.Writer) {
+	fmt.Fprintln(w, "digraph certgraph {")
+	for _, domain := range g.sortedDomains() {
+		node := g.Nodes[domain]
+		color := depthColors[node.Depth%len(depthColors)]
+		fmt.Fprintf(w, "  %q [depth=%d, style=filled, fillcolor=%q];\n", domain, node.Depth, color)
+	}
+	for _, domain := range g.sortedDomains() {
+		node := g.Nodes[domain]
+		for _, neighbor := range *node.Neighbors {
+			fmt.Fprintf(w, "  %q -> %q [source=%q];\n", domain, neighbor.Domain, neighbor.Source)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// GEXF (Graph Exchange XML Format) node/edge schema, trimmed to what Gephi
+// needs to render the graph: https://gexf.net/schema.html
+type gexfGraph struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfInner `xml:"graph"`
+}
+
+type gexfInner struct {
+	DefaultEdgeType string     `xml:"defaultedgetype,attr"`
+	Nodes           []gexfNode `xml:"nodes>node"`
+	Edges           []gexfEdge `xml:"edges>edge"`
+}
+
+type gexfNode struct {
+	ID    string `xml:"id,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type gexfEdge struct {
+	ID     int    `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Kind   string `xml:"kind,attr"`
+}
+
+func writeGraphGEXF(g *Graph, w io.Writer) {
+	doc := gexfGraph{
+		Version: "1.3",
+		Graph:   gexfInner{DefaultEdgeType: "directed"},
+	}
+
+	edgeID := 0
+	for _, domain := range g.sortedDomains() {
+		node := g.Nodes[domain]
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{ID: domain, Label: domain})
+		for _, neighbor := range *node.Neighbors {
+			doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+				ID:     edgeID,
+				Source: domain,
+				Target: neighbor.Domain,
+				Kind:   neighbor.Source,
+			})
+			edgeID++
+		}
+	}
+
+	fmt.Fprint(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(doc)
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGraph builds a small two-node graph (one cert-derived and one
+// DNS-derived edge) shared by the format-specific tests below.
+func testGraph() *Graph {
+	bNeighbors := []Neighbor{}
+	aNeighbors := []Neighbor{
+		{Domain: "b.example.com", Source: "cert"},
+		{Domain: "mail.example.com", Source: "dns"},
+	}
+	return &Graph{Nodes: map[string]*DomainNode{
+		"a.example.com": {
+			Domain:    "a.example.com",
+			Depth:     0,
+			Neighbors: &aNeighbors,
+			Cert: &CertInfo{
+				Fingerprint: "deadbeef",
+				Issuer:      "Test CA",
+				NotBefore:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				NotAfter:    time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		"b.example.com": {
+			Domain:    "b.example.com",
+			Depth:     1,
+			Neighbors: &bNeighbors,
+		},
+	}}
+}
+
+func TestWriteGraphJSONUsesLowerCamelKeysThroughout(t *testing.T) {
+	var buf bytes.Buffer
+	writeGraphJSON(testGraph(), &buf)
+
+	dec := json.NewDecoder(&buf)
+	var records []map[string]interface{}
+	for dec.More() {
+		var record map[string]interface{}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("decode NDJSON record: %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	a := records[0]
+	if a["domain"] != "a.example.com" {
+		t.Fatalf("got domain %v, want a.example.com", a["domain"])
+	}
+	if a["fingerprint"] != "deadbeef" {
+		t.Fatalf("got fingerprint %v, want deadbeef", a["fingerprint"])
+	}
+
+	neighbors, ok := a["neighbors"].([]interface{})
+	if !ok || len(neighbors) != 2 {
+		t.Fatalf("got neighbors %v, want a 2-element array", a["neighbors"])
+	}
+	first, ok := neighbors[0].(map[string]interface{})
+	if !ok {
+		t.Fatalf("neighbor entry is not an object: %v", neighbors[0])
+	}
+	if _, hasLowerDomain := first["domain"]; !hasLowerDomain {
+		t.Fatalf("neighbor missing lowerCamel %q key: %v", "domain", first)
+	}
+	if _, hasLowerSource := first["source"]; !hasLowerSource {
+		t.Fatalf("neighbor missing lowerCamel %q key: %v", "source", first)
+	}
+	if _, hasUpperDomain := first["Domain"]; hasUpperDomain {
+		t.Fatalf("neighbor has stray PascalCase %q key: %v", "Domain", first)
+	}
+}
+
+func TestWriteGraphDOTEmitsNodesAndEdges(t *testing.T) {
+	var buf bytes.Buffer
+	writeGraphDOT(testGraph(), &buf)
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "digraph certgraph {") {
+		t.Fatalf("output doesn't start with the expected digraph header:\n%s", out)
+	}
+	if !strings.Contains(out, `"a.example.com" [depth=0`) {
+		t.Fatalf("missing node declaration for a.example.com:\n%s", out)
+	}
+	if !strings.Contains(out, `"a.example.com" -> "b.example.com" [source="cert"]`) {
+		t.Fatalf("missing cert-sourced edge a.example.com -> b.example.com:\n%s", out)
+	}
+	if !strings.Contains(out, `"a.example.com" -> "mail.example.com" [source="dns"]`) {
+		t.Fatalf("missing dns-sourced edge a.example.com -> mail.example.com:\n%s", out)
+	}
+}
+
+func TestWriteGraphGEXFRoundTrips(t *testing.T) {
+	var buf bytes.Buffer
+	writeGraphGEXF(testGraph(), &buf)
+
+	var doc gexfGraph
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("unmarshal GEXF output: %v", err)
+	}
+	if len(doc.Graph.Nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(doc.Graph.Nodes))
+	}
+	if len(doc.Graph.Edges) != 2 {
+		t.Fatalf("got %d edges, want 2", len(doc.Graph.Edges))
+	}
+	for _, edge := range doc.Graph.Edges {
+		if edge.Source != "a.example.com" {
+			t.Fatalf("got edge source %q, want a.example.com", edge.Source)
+		}
+	}
+}
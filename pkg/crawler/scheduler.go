@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// domainQueue is an unbounded FIFO of pending DomainNodes. It's the classic
+// "infinite buffered channel" pattern: a goroutine shuttles items between an
+// input and output channel through a growable in-memory buffer, so
+// producers never block on a full channel no matter how deep the BFS
+// fan-out gets.
+type domainQueue struct {
+	in  chan *DomainNode
+	out chan *DomainNode
+}
+
+func newDomainQueue(ctx context.Context) *domainQueue {
+	q := &domainQueue{
+		in:  make(chan *DomainNode),
+		out: make(chan *DomainNode),
+	}
+	go q.run(ctx)
+	return q
+}
+
+func (q *domainQueue) run(ctx context.Context) {
+	var buffer []*DomainNode
+	for {
+		var out chan *DomainNode
+		var next *DomainNode
+		if len(buffer) > 0 {
+			out = q.out
+			next = buffer[0]
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-q.in:
+			buffer = append(buffer, item)
+		case out <- next:
+			buffer = buffer[1:]
+		}
+	}
+}
+
+func (q *domainQueue) push(n *DomainNode) {
+	q.in <- n
+}
+
+// rateLimiter is a token-bucket limiter good for roughly one request per
+// 1/qps seconds. It tracks only the next time a token is due, computed from
+// a monotonic clock read under a mutex, so limiting thousands of hosts
+// doesn't mean spawning thousands of ticker goroutines. A nil *rateLimiter
+// is unlimited, so callers don't need to branch on whether limiting is
+// configured.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // zero until the first wait
+}
+
+func newRateLimiter(qps float64) *rateLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	if rl == nil {
+		return nil
+	}
+
+	rl.mu.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	due := rl.next
+	rl.next = rl.next.Add(rl.interval)
+	rl.mu.Unlock()
+
+	d := time.Until(due)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hostLimiters lazily creates one rateLimiter per host, so --per-host-qps
+// throttles requests to any single host without slowing down the overall
+// crawl across hosts.
+type hostLimiters struct {
+	qps   float64
+	mu    sync.Mutex
+	byKey map[string]*rateLimiter
+}
+
+func newHostLimiters(qps float64) *hostLimiters {
+	return &hostLimiters{qps: qps, byKey: make(map[string]*rateLimiter)}
+}
+
+func (h *hostLimiters) get(host string) *rateLimiter {
+	if h == nil || h.qps <= 0 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if rl, ok := h.byKey[host]; ok {
+		return rl
+	}
+	rl := newRateLimiter(h.qps)
+	h.byKey[host] = rl
+	return rl
+}
+
+// Metrics is a point-in-time snapshot of a Crawl's backpressure: how much
+// work is queued, how much is actively in flight, and how much has been
+// drained so far.
+type Metrics struct {
+	Queued   int64
+	InFlight int64
+	Visited  int64
+}
@@ -0,0 +1,211 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StartTLSProtocols are the handshakes supported by --starttls.
+var StartTLSProtocols = map[string]bool{
+	"smtp": true,
+	"imap": true,
+	"pop3": true,
+	"xmpp": true,
+	"ftp":  true,
+}
+
+// starttlsForPort maps well-known plaintext ports to their STARTTLS
+// protocol, used when --starttls=auto.
+var starttlsForPort = map[string]string{
+	"25":   "smtp",
+	"587":  "smtp",
+	"110":  "pop3",
+	"143":  "imap",
+	"21":   "ftp",
+	"5222": "xmpp",
+}
+
+// DefaultPort gives the conventional plaintext port for each --starttls
+// protocol, so the CLI can pick a sensible --port default when the user
+// names a protocol explicitly but doesn't override --port themselves.
+var DefaultPort = map[string]string{
+	"smtp": "25",
+	"imap": "143",
+	"pop3": "110",
+	"ftp":  "21",
+	"xmpp": "5222",
+}
+
+// starttlsProtocol resolves the --starttls flag value (including "auto")
+// against the port being scanned.
+func starttlsProtocol(flagValue, port string) string {
+	if flagValue != "auto" {
+		return flagValue
+	}
+	return starttlsForPort[port]
+}
+
+// starttlsUpgrade performs the plaintext protocol handshake that tells the
+// server to switch the connection to TLS, leaving conn ready to be wrapped
+// with tls.Client. It returns an error if the server doesn't agree to
+// upgrade.
+func starttlsUpgrade(conn net.Conn, protocol, host string) error {
+	switch protocol {
+	case "smtp":
+		return starttlsSMTP(conn, host)
+	case "imap":
+		return starttlsIMAP(conn)
+	case "pop3":
+		return starttlsPOP3(conn)
+	case "xmpp":
+		return starttlsXMPP(conn, host)
+	case "ftp":
+		return starttlsFTP(conn)
+	default:
+		return fmt.Errorf("unsupported starttls protocol: %q", protocol)
+	}
+}
+
+func starttlsSMTP(conn net.Conn, host string) error {
+	r := bufio.NewReader(conn)
+	if _, err := readSMTPReply(r); err != nil { // server banner
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "EHLO %s\r\n", host); err != nil {
+		return err
+	}
+	if _, err := readSMTPReply(r); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	code, err := readSMTPReply(r)
+	if err != nil {
+		return err
+	}
+	if code != "220" {
+		return fmt.Errorf("smtp STARTTLS refused: %s", code)
+	}
+	return nil
+}
+
+// readSMTPReply reads a (possibly multi-line) SMTP reply and returns its
+// status code.
+func readSMTPReply(r *bufio.Reader) (string, error) {
+	var code string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if len(line) < 4 {
+			continue
+		}
+		code = line[0:3]
+		if line[3] == ' ' { // "250 " ends a multi-line reply, "250-" continues it
+			return code, nil
+		}
+	}
+}
+
+func starttlsIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil { // server greeting
+		return err
+	}
+	if _, err := fmt.Fprint(conn, "a1 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "a1 OK") {
+		return fmt.Errorf("imap STARTTLS refused: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+func starttlsPOP3(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil { // server greeting
+		return err
+	}
+	if _, err := fmt.Fprint(conn, "STLS\r\n"); err != nil {
+		return err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("pop3 STLS refused: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+func starttlsFTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil { // server greeting
+		return err
+	}
+	if _, err := fmt.Fprint(conn, "AUTH TLS\r\n"); err != nil {
+		return err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "234") {
+		return fmt.Errorf("ftp AUTH TLS refused: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// starttlsXMPP negotiates a minimal client-to-server stream and requests
+// STARTTLS per RFC 6120. It doesn't attempt to parse the full
+// <stream:features/> XML, just scans for the starttls tag.
+func starttlsXMPP(conn net.Conn, host string) error {
+	r := bufio.NewReader(conn)
+	_, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>\n", host)
+	if err != nil {
+		return err
+	}
+
+	features, err := readXMPPUntil(r, "</stream:features>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(features, "starttls") {
+		return fmt.Errorf("xmpp server does not advertise STARTTLS")
+	}
+
+	if _, err := fmt.Fprint(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	proceed, err := readXMPPUntil(r, ">")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(proceed, "proceed") {
+		return fmt.Errorf("xmpp STARTTLS refused: %s", proceed)
+	}
+	return nil
+}
+
+func readXMPPUntil(r *bufio.Reader, marker string) (string, error) {
+	var buf strings.Builder
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return buf.String(), err
+		}
+		buf.WriteByte(b)
+		if strings.Contains(buf.String(), marker) {
+			return buf.String(), nil
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package crawler
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+// pipeConn returns a client/server pair wired together with net.Pipe, so a
+// starttlsXxx handshake function can be driven against a fake server
+// goroutine without touching the network.
+func pipeConn(t *testing.T) (client net.Conn, server *bufio.ReadWriter) {
+	t.Helper()
+	c, s := net.Pipe()
+	t.Cleanup(func() { c.Close(); s.Close() })
+	return c, bufio.NewReadWriter(bufio.NewReader(s), bufio.NewWriter(s))
+}
+
+func TestStarttlsSMTPAcceptsMultilineReply(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("220 mail.example.com ESMTP\r\n")
+		server.Flush()
+		server.ReadString('\n') // EHLO
+		server.WriteString("250-mail.example.com\r\n250 STARTTLS\r\n")
+		server.Flush()
+		server.ReadString('\n') // STARTTLS
+		server.WriteString("220 Ready to start TLS\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsSMTP(client, "mail.example.com"); err != nil {
+		t.Fatalf("starttlsSMTP: unexpected error: %v", err)
+	}
+}
+
+func TestStarttlsSMTPRefused(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("220 mail.example.com ESMTP\r\n")
+		server.Flush()
+		server.ReadString('\n') // EHLO
+		server.WriteString("250 mail.example.com\r\n")
+		server.Flush()
+		server.ReadString('\n') // STARTTLS
+		server.WriteString("502 Command not implemented\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsSMTP(client, "mail.example.com"); err == nil {
+		t.Fatal("starttlsSMTP: expected an error for a refused STARTTLS, got nil")
+	}
+}
+
+func TestStarttlsIMAPAccepted(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("* OK IMAP4rev1 Server ready\r\n")
+		server.Flush()
+		server.ReadString('\n') // a1 STARTTLS
+		server.WriteString("a1 OK Begin TLS negotiation now\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsIMAP(client); err != nil {
+		t.Fatalf("starttlsIMAP: unexpected error: %v", err)
+	}
+}
+
+func TestStarttlsIMAPRefused(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("* OK IMAP4rev1 Server ready\r\n")
+		server.Flush()
+		server.ReadString('\n') // a1 STARTTLS
+		server.WriteString("a1 NO command disabled\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsIMAP(client); err == nil {
+		t.Fatal("starttlsIMAP: expected an error for a refused STARTTLS, got nil")
+	}
+}
+
+func TestStarttlsPOP3Accepted(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("+OK POP3 server ready\r\n")
+		server.Flush()
+		server.ReadString('\n') // STLS
+		server.WriteString("+OK\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsPOP3(client); err != nil {
+		t.Fatalf("starttlsPOP3: unexpected error: %v", err)
+	}
+}
+
+func TestStarttlsPOP3Refused(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("+OK POP3 server ready\r\n")
+		server.Flush()
+		server.ReadString('\n') // STLS
+		server.WriteString("-ERR command not supported\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsPOP3(client); err == nil {
+		t.Fatal("starttlsPOP3: expected an error for a refused STLS, got nil")
+	}
+}
+
+func TestStarttlsFTPAccepted(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("220 FTP server ready\r\n")
+		server.Flush()
+		server.ReadString('\n') // AUTH TLS
+		server.WriteString("234 AUTH TLS successful\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsFTP(client); err != nil {
+		t.Fatalf("starttlsFTP: unexpected error: %v", err)
+	}
+}
+
+func TestStarttlsFTPRefused(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		server.WriteString("220 FTP server ready\r\n")
+		server.Flush()
+		server.ReadString('\n') // AUTH TLS
+		server.WriteString("502 command not implemented\r\n")
+		server.Flush()
+	}()
+
+	if err := starttlsFTP(client); err == nil {
+		t.Fatal("starttlsFTP: expected an error for a refused AUTH TLS, got nil")
+	}
+}
+
+// readXMPPStreamOpen drains the client's opening <?xml ...?><stream:stream
+// ...> preamble, which contains two '>' characters (one ending the XML
+// declaration, one ending the stream tag), so it takes two ReadString('>')
+// calls to consume in full.
+func readXMPPStreamOpen(server *bufio.ReadWriter) {
+	server.ReadString('>')
+	server.ReadString('>')
+}
+
+func TestStarttlsXMPPAccepted(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		readXMPPStreamOpen(server)
+		server.WriteString("<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/></stream:features>")
+		server.Flush()
+		server.ReadString('>') // <starttls .../>
+		server.WriteString("<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		server.Flush()
+	}()
+
+	if err := starttlsXMPP(client, "im.example.com"); err != nil {
+		t.Fatalf("starttlsXMPP: unexpected error: %v", err)
+	}
+}
+
+func TestStarttlsXMPPNotAdvertised(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		readXMPPStreamOpen(server)
+		server.WriteString("<stream:features></stream:features>")
+		server.Flush()
+	}()
+
+	if err := starttlsXMPP(client, "im.example.com"); err == nil {
+		t.Fatal("starttlsXMPP: expected an error when STARTTLS isn't advertised, got nil")
+	}
+}
+
+func TestStarttlsXMPPRefused(t *testing.T) {
+	client, server := pipeConn(t)
+	go func() {
+		readXMPPStreamOpen(server)
+		server.WriteString("<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/></stream:features>")
+		server.Flush()
+		server.ReadString('>') // <starttls .../>
+		server.WriteString("<failure xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		server.Flush()
+	}()
+
+	if err := starttlsXMPP(client, "im.example.com"); err == nil {
+		t.Fatal("starttlsXMPP: expected an error for a refused STARTTLS, got nil")
+	}
+}